@@ -0,0 +1,519 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rawResponse mirrors Response but keeps Result as raw JSON, so a [Conn]
+// waiting on a reply can decode it into the caller's own type.
+type rawResponse struct {
+	Version Version         `json:"jsonrpc"`
+	ID      ID              `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Conn is a single bidirectional JSON-RPC 2.0 connection. Besides serving
+// inbound requests through the registered handlers, like [Listener] always
+// has, it lets this side *call* the peer: [Conn.Call] and [Conn.Notify]
+// send outbound requests and notifications, which is what a real go/packages
+// driver needs to ask a JS host to read a file or fetch a module on demand.
+type Conn struct {
+	conn     net.Conn
+	reader   MessageReader
+	handlers map[string]RequestHandler
+	canceler requestCanceler
+	timeout  func(method string) time.Duration
+	logger   Logger
+
+	writeMu sync.Mutex
+	writer  MessageWriter
+
+	nextID  atomic.Int64
+	pending sync.Map // ID.key() -> chan *rawResponse
+
+	deadline     deadlineTimer
+	readDeadline deadlineTimer
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewConn wraps conn as a [Conn] serving handlers, applying the same
+// [ListenerOption]s accepted by [NewListener] (e.g. [WithFramer],
+// [WithRequestTimeout]).
+func NewConn(conn net.Conn, handlers map[string]RequestHandler, opts ...ListenerOption) *Conn {
+	l := &Listener{handlers: handlers, framer: LineFramer{}, logger: noopLogger{}}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l.newConn(conn)
+}
+
+func (l *Listener) newConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn:     conn,
+		reader:   l.framer.Reader(conn),
+		writer:   l.framer.Writer(conn),
+		handlers: l.handlers,
+		timeout:  l.timeoutFor,
+		logger:   l.logger,
+		closed:   make(chan struct{}),
+	}
+}
+
+// connContextKey is the context key under which [Conn] stashes itself for
+// the duration of a single request, so a [RequestHandler] can reach
+// [ConnFromContext] and call back into the peer (e.g. to have a browser
+// host read a file the driver can't reach on its own).
+type connContextKey struct{}
+
+// ConnFromContext returns the [Conn] currently serving ctx's request, if
+// any. It is only populated for requests dispatched by a [Conn] (including
+// ones created via [Listener.ListenStream]); it is absent for directly
+// invoked handlers, e.g. in tests.
+func ConnFromContext(ctx context.Context) (*Conn, bool) {
+	c, ok := ctx.Value(connContextKey{}).(*Conn)
+	return c, ok
+}
+
+// SetDeadline arms an overall connection deadline, mirroring
+// [net.Conn.SetDeadline]: once it elapses the connection is closed and all
+// in-flight and future work on it fails. It uses a resettable timer so
+// calling it repeatedly (as read/write activity extends the deadline)
+// never leaks the previous timer.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.deadline.Reset(t, func() { _ = c.conn.Close() })
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection and,
+// like [Conn.SetDeadline], closes the connection once t passes. The
+// deadline is absolute: incoming messages do not extend it.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Reset(t, func() { _ = c.conn.Close() })
+	return c.conn.SetReadDeadline(t)
+}
+
+// Run reads and dispatches messages from the connection until ctx is
+// canceled or the connection is closed.
+func (c *Conn) Run(ctx context.Context) error {
+	connCtx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	defer c.Close()
+
+	go func() {
+		<-ctx.Done()
+		_ = c.conn.Close()
+	}()
+
+	for {
+		data, err := c.reader.ReadMessage()
+		if len(data) > 0 {
+			if derr := c.dispatch(connCtx, data); derr != nil {
+				c.logger.DispatchFailed(derr)
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				c.logger.ConnectionClosed(nil)
+				return nil
+			}
+			if connCtx.Err() != nil {
+				c.logger.ConnectionClosed(connCtx.Err())
+				return nil
+			}
+			err = fmt.Errorf("connection read failed: %w", err)
+			c.logger.ConnectionClosed(err)
+			return err
+		}
+	}
+}
+
+// Close cancels every in-flight inbound request and fails every pending
+// outbound call. It is safe to call more than once.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.canceler.cancelAll()
+		close(c.closed)
+		c.pending.Range(func(key, v any) bool {
+			c.pending.Delete(key)
+			v.(chan *rawResponse) <- &rawResponse{Error: NewError(ErrorCodeInternalError, net.ErrClosed)}
+			return true
+		})
+	})
+	return nil
+}
+
+// dispatch routes a single message, which is either a request/notification
+// addressed to us, a batch of those (§6), or a response to a call we made.
+func (c *Conn) dispatch(ctx context.Context, data []byte) error {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return c.handleBatch(ctx, trimmed)
+	}
+
+	var probe struct {
+		Method *string `json:"method"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return c.serveError(ID{}, NewError(ErrorCodeParseError, err))
+	}
+
+	if probe.Method == nil {
+		return c.deliverResponse(data)
+	}
+
+	rsp := c.processRequest(ctx, data, true)
+	if rsp != nil {
+		return c.serveResponse(rsp)
+	}
+	return nil
+}
+
+func (c *Conn) deliverResponse(data []byte) error {
+	var rsp rawResponse
+	if err := json.Unmarshal(data, &rsp); err != nil {
+		return fmt.Errorf("malformed response: %w", err)
+	}
+
+	v, ok := c.pending.LoadAndDelete(rsp.ID.key())
+	if !ok {
+		return fmt.Errorf("response for unknown request id %s", rsp.ID)
+	}
+
+	v.(chan *rawResponse) <- &rsp
+	return nil
+}
+
+// Call sends method with params to the peer and decodes its result into
+// result (which may be nil). It blocks until a response arrives, ctx is
+// done, or the connection closes; on ctx cancellation it notifies the peer
+// with [NotificationCancelRequest] so in-flight work there can stop too.
+func (c *Conn) Call(ctx context.Context, method string, params, result any) error {
+	paramsRaw, err := marshalParams(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal params: %w", err)
+	}
+
+	id := IDInt(c.nextID.Add(1))
+	reply := make(chan *rawResponse, 1)
+	c.pending.Store(id.key(), reply)
+	defer c.pending.Delete(id.key())
+
+	req := &Request{ID: &id, Method: method, Params: paramsRaw}
+	if err := c.writeMessage(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = c.Notify(context.Background(), NotificationCancelRequest, id)
+			case <-done:
+			}
+		}()
+	}
+
+	select {
+	case rsp := <-reply:
+		if rsp.Error != nil {
+			return rsp.Error
+		}
+		if result == nil || len(rsp.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(rsp.Result, result)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+// Notify sends method with params to the peer without waiting for a reply.
+func (c *Conn) Notify(ctx context.Context, method string, params any) error {
+	paramsRaw, err := marshalParams(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal params: %w", err)
+	}
+
+	return c.writeMessage(&Request{Method: method, Params: paramsRaw})
+}
+
+// deadlineTimer arms a callback to fire once at some point in time, same as
+// [time.AfterFunc], but lets the deadline be moved or cleared arbitrarily
+// many times without leaking the superseded timer. Borrowed from the
+// deadline-timer pattern in netstack's gonet adapter.
+type deadlineTimer struct {
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+// Reset arms onExpire to run when t is reached, replacing and stopping any
+// previously armed timer. A zero t disarms the deadline entirely.
+func (d *deadlineTimer) Reset(t time.Time, onExpire func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if t.IsZero() {
+		return
+	}
+
+	d.timer = time.AfterFunc(time.Until(t), onExpire)
+}
+
+func marshalParams(params any) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	return json.Marshal(params)
+}
+
+func (c *Conn) writeMessage(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writer.WriteMessage(data)
+}
+
+type requestCanceler struct {
+	m sync.Map
+}
+
+func (rc *requestCanceler) cancelRequest(reqID ID) {
+	v, ok := rc.m.LoadAndDelete(reqID.key())
+	if !ok {
+		return
+	}
+
+	cancelFn := v.(context.CancelFunc)
+	cancelFn()
+}
+
+func (rc *requestCanceler) finishRequest(reqID ID) bool {
+	_, ok := rc.m.LoadAndDelete(reqID.key())
+	return ok
+}
+
+func (rc *requestCanceler) cancelAll() {
+	rc.m.Range(func(k, v any) bool {
+		cancelFn := v.(context.CancelFunc)
+		cancelFn()
+		rc.m.Delete(k)
+		return true
+	})
+}
+
+func (rc *requestCanceler) addRequest(reqID ID, cancelFn context.CancelFunc) {
+	rc.m.Store(reqID.key(), cancelFn)
+}
+
+// handleBatch dispatches every element of a batch concurrently, then writes
+// a single array response containing only the non-notification results. A
+// batch consisting entirely of notifications produces no response at all.
+func (c *Conn) handleBatch(ctx context.Context, data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return c.serveError(ID{}, NewError(ErrorCodeParseError, err))
+	}
+	if len(items) == 0 {
+		return c.serveError(ID{}, ErrorCodeInvalidRequest.Errorf("empty batch"))
+	}
+
+	results := make([]*Response, len(items))
+
+	var wg sync.WaitGroup
+	wg.Add(len(items))
+	for i, item := range items {
+		go func(i int, item json.RawMessage) {
+			defer wg.Done()
+			results[i] = c.processRequest(ctx, item, false)
+		}(i, item)
+	}
+	wg.Wait()
+
+	responses := make([]*Response, 0, len(results))
+	for _, rsp := range results {
+		if rsp != nil {
+			responses = append(responses, rsp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+
+	return c.serveResponses(responses)
+}
+
+// processRequest parses and executes a single request object, returning the
+// response to send, or nil for a notification. When async is true (a
+// top-level, non-batch request), the handler runs in its own goroutine and
+// streams its response as soon as it's ready, matching the listener's
+// historical non-blocking behavior, and processRequest itself returns nil;
+// a parse error or an unknown method is still answered by the returned
+// response.
+// Batch elements always run with async=false, so handleBatch can wait for
+// every result before replying with the combined array.
+func (c *Conn) processRequest(ctx context.Context, data []byte, async bool) *Response {
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return NewError(ErrorCodeParseError, err).AsResponse(ID{})
+	}
+
+	if req.IsNotification() {
+		c.logger.NotificationReceived(req.Method)
+		if err := c.handleNotification(&req); err != nil {
+			// Per §6 of the spec, a Notification MUST NOT be answered,
+			// even when it can't be handled - there is simply nowhere to
+			// send an error to.
+			c.logger.DispatchFailed(fmt.Errorf("notification %q: %w", req.Method, err))
+		}
+		return nil
+	}
+
+	c.logger.RequestReceived(req.Method, *req.ID)
+
+	handler, ok := c.handlers[req.Method]
+	if !ok {
+		err := ErrorCodeMethodNotFound.Errorf("method not found: %q", req.Method)
+		c.logger.RequestCompleted(req.Method, *req.ID, 0, err.Code)
+		return err.AsResponse(*req.ID)
+	}
+
+	reqCtx, cancelFn := c.withTimeout(ctx, req.Method)
+	reqCtx = context.WithValue(reqCtx, connContextKey{}, c)
+	c.canceler.addRequest(*req.ID, cancelFn)
+	start := time.Now()
+
+	run := func() *Response {
+		defer cancelFn()
+		defer c.canceler.finishRequest(*req.ID)
+
+		rsp := &Response{ID: *req.ID}
+
+		out, err := handler.HandleRequest(reqCtx, req.Params)
+		switch {
+		case errors.Is(reqCtx.Err(), context.DeadlineExceeded):
+			rsp.Error = ErrorCodeRequestTimeout.Errorf("request timed out: %s", req.Method)
+		case err != nil:
+			rsp.Error = WrapError(err)
+		}
+		rsp.Result = out
+
+		var errCode ErrorCode
+		if rsp.Error != nil {
+			errCode = rsp.Error.Code
+		}
+		c.logger.RequestCompleted(req.Method, *req.ID, time.Since(start), errCode)
+		return rsp
+	}
+
+	if !async {
+		return c.recoverPanic(req.Method, *req.ID, run)
+	}
+
+	go func() {
+		rsp := c.recoverPanic(req.Method, *req.ID, run)
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.serveResponse(rsp); err != nil {
+			c.logger.ResponseFailed(req.Method, *req.ID, err)
+		}
+	}()
+	return nil
+}
+
+// withTimeout derives a child context for a request to method, bounded by
+// the configured request/handler timeout when one applies, and a plain
+// cancelable context (the $/cancelRequest path) otherwise.
+func (c *Conn) withTimeout(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	if d := c.timeout(method); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (c *Conn) recoverPanic(method string, reqID ID, fn func() *Response) (rsp *Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.PanicRecovered(method, reqID, r)
+			rsp = ErrorCodeInternalError.Errorf("%s", r).AsResponse(reqID)
+		}
+	}()
+	return fn()
+}
+
+func (c *Conn) handleNotification(req *Request) error {
+	if req.Method != NotificationCancelRequest {
+		return ErrorCodeMethodNotFound.Errorf(
+			"unsupported notification %q", req.Method,
+		)
+	}
+
+	var reqID ID
+	if err := json.Unmarshal(req.Params, &reqID); err != nil {
+		return ErrorCodeInvalidParams.Errorf(
+			"cannot read params: %s", err,
+		)
+	}
+
+	if reqID.IsZero() {
+		return ErrorCodeInvalidParams.Errorf(
+			"missing request ID",
+		)
+	}
+
+	c.canceler.cancelRequest(reqID)
+	return nil
+}
+
+func (c *Conn) serveError(reqID ID, e *Error) error {
+	return c.serveResponse(e.AsResponse(reqID))
+}
+
+func (c *Conn) serveResponse(rsp *Response) error {
+	data, err := json.Marshal(rsp)
+	if err != nil {
+		return fmt.Errorf("failed to serialize response: %w", err)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writer.WriteMessage(data)
+}
+
+// serveResponses writes a batch of responses as a single JSON array, per
+// §6 of the JSON-RPC 2.0 spec.
+func (c *Conn) serveResponses(rsps []*Response) error {
+	data, err := json.Marshal(rsps)
+	if err != nil {
+		return fmt.Errorf("failed to serialize batch response: %w", err)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writer.WriteMessage(data)
+}
@@ -0,0 +1,117 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+type echoParams struct {
+	X int `json:"x"`
+}
+
+func echoHandlers() map[string]RequestHandler {
+	return map[string]RequestHandler{
+		"echo": NewHandler(func(_ context.Context, req echoParams) (*echoParams, error) {
+			return &echoParams{X: req.X * 2}, nil
+		}),
+	}
+}
+
+// readLine reads a single newline-framed message, failing the test if none
+// arrives within a few seconds.
+func readLine(t *testing.T, conn net.Conn) []byte {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("SetReadDeadline: %v", err)
+	}
+	reader := LineFramer{}.Reader(conn)
+	data, err := reader.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	return data
+}
+
+func TestConnBatchDispatchReturnsOnlyNonNotificationResults(t *testing.T) {
+	client, serverSide := net.Pipe()
+	defer client.Close()
+
+	c := NewConn(serverSide, echoHandlers())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	batch := `[` +
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"x":1}},` +
+		`{"jsonrpc":"2.0","method":"echo","params":{"x":2}},` +
+		`{"jsonrpc":"2.0","id":"two","method":"echo","params":{"x":3}}` +
+		`]` + "\n"
+	go func() { _, _ = client.Write([]byte(batch)) }()
+
+	data := readLine(t, client)
+
+	var rsps []rawResponse
+	if err := json.Unmarshal(data, &rsps); err != nil {
+		t.Fatalf("unmarshal batch response %s: %v", data, err)
+	}
+	if len(rsps) != 2 {
+		t.Fatalf("got %d responses, want 2 (the notification must not produce one): %s", len(rsps), data)
+	}
+
+	byID := map[string]rawResponse{}
+	for _, rsp := range rsps {
+		byID[rsp.ID.key()] = rsp
+	}
+
+	one, ok := byID[IDInt(1).key()]
+	if !ok {
+		t.Fatalf("missing response for id=1 in %s", data)
+	}
+	var gotOne echoParams
+	if err := json.Unmarshal(one.Result, &gotOne); err != nil || gotOne.X != 2 {
+		t.Errorf("response for id=1: %+v, err=%v, want X=2", gotOne, err)
+	}
+
+	two, ok := byID[IDString("two").key()]
+	if !ok {
+		t.Fatalf(`missing response for id="two" in %s`, data)
+	}
+	var gotTwo echoParams
+	if err := json.Unmarshal(two.Result, &gotTwo); err != nil || gotTwo.X != 6 {
+		t.Errorf(`response for id="two": %+v, err=%v, want X=6`, gotTwo, err)
+	}
+}
+
+func TestConnBatchOfOnlyNotificationsProducesNoResponse(t *testing.T) {
+	client, serverSide := net.Pipe()
+	defer client.Close()
+
+	c := NewConn(serverSide, echoHandlers())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	batch := `[{"jsonrpc":"2.0","method":"echo","params":{"x":1}}]` + "\n"
+
+	// A second, ordinary request, written after the batch, confirms the
+	// notification-only batch produced no reply of its own: if it had, this
+	// read would return the stray batch response instead of the single echo
+	// response below.
+	go func() {
+		_, _ = client.Write([]byte(batch))
+		_, _ = client.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"x":5}}` + "\n"))
+	}()
+
+	data := readLine(t, client)
+	var rsp rawResponse
+	if err := json.Unmarshal(data, &rsp); err != nil {
+		t.Fatalf("unmarshal response %s: %v", data, err)
+	}
+	var got echoParams
+	if err := json.Unmarshal(rsp.Result, &got); err != nil || got.X != 10 {
+		t.Fatalf("response %+v, err=%v, want X=10 (first message must be the notification-only batch producing nothing)", got, err)
+	}
+}
@@ -0,0 +1,145 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MessageReader reads successive framed JSON-RPC messages from a stream,
+// returning each message's raw JSON payload with framing removed.
+type MessageReader interface {
+	ReadMessage() ([]byte, error)
+}
+
+// MessageWriter frames and writes a single raw JSON-RPC message.
+type MessageWriter interface {
+	WriteMessage(msg []byte) error
+}
+
+// Framer defines how JSON-RPC messages are delimited on the wire. It lets
+// [Listener] serve transports other than the newline-delimited one it was
+// originally built for, e.g. LSP-style length-prefixed streams.
+type Framer interface {
+	Reader(io.Reader) MessageReader
+	Writer(io.Writer) MessageWriter
+}
+
+// LineFramer frames each message as one JSON value per line. This is
+// [Listener]'s original behavior and its default, kept for backward
+// compatibility. It breaks on payloads containing an embedded newline.
+type LineFramer struct{}
+
+func (LineFramer) Reader(r io.Reader) MessageReader {
+	return &lineReader{r: bufio.NewReader(r)}
+}
+
+func (LineFramer) Writer(w io.Writer) MessageWriter {
+	return &lineWriter{w: w}
+}
+
+type lineReader struct {
+	r *bufio.Reader
+}
+
+func (lr *lineReader) ReadMessage() ([]byte, error) {
+	for {
+		data, err := lr.r.ReadBytes('\n')
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) > 0 {
+			return trimmed, err
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+type lineWriter struct {
+	w io.Writer
+}
+
+func (lw *lineWriter) WriteMessage(msg []byte) error {
+	if _, err := lw.w.Write(msg); err != nil {
+		return err
+	}
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		return nil
+	}
+	_, err := lw.w.Write([]byte("\n"))
+	return err
+}
+
+// HeaderFramer frames messages with LSP-style Content-Length (and optional
+// Content-Type) headers, as used by gopls's jsonrpc2_v2. It lets the driver
+// be embedded in editor-style hosts that expect length-prefixed framing.
+type HeaderFramer struct{}
+
+func (HeaderFramer) Reader(r io.Reader) MessageReader {
+	return &headerReader{r: bufio.NewReader(r)}
+}
+
+func (HeaderFramer) Writer(w io.Writer) MessageWriter {
+	return &headerWriter{w: w}
+}
+
+type headerReader struct {
+	r *bufio.Reader
+}
+
+func (hr *headerReader) ReadMessage() ([]byte, error) {
+	length := -1
+
+	for {
+		line, err := hr.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("jsonrpc: malformed header %q", line)
+		}
+
+		switch strings.TrimSpace(name) {
+		case "Content-Length":
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("jsonrpc: invalid Content-Length: %w", err)
+			}
+		case "Content-Type":
+			// Accepted but not interpreted; the body is always JSON.
+		}
+	}
+
+	if length < 0 {
+		return nil, errors.New("jsonrpc: missing Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(hr.r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+type headerWriter struct {
+	w io.Writer
+}
+
+func (hw *headerWriter) WriteMessage(msg []byte) error {
+	if _, err := fmt.Fprintf(hw.w, "Content-Length: %d\r\n\r\n", len(msg)); err != nil {
+		return err
+	}
+	_, err := hw.w.Write(msg)
+	return err
+}
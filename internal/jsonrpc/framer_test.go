@@ -0,0 +1,135 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLineFramerRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := LineFramer{}.Writer(&buf)
+
+	msgs := []string{`{"jsonrpc":"2.0","id":1,"method":"a"}`, `{"jsonrpc":"2.0","id":2,"method":"b"}`}
+	for _, m := range msgs {
+		if err := w.WriteMessage([]byte(m)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+	}
+
+	r := LineFramer{}.Reader(&buf)
+	for _, want := range msgs {
+		got, err := r.ReadMessage()
+		if err != nil && err != io.EOF {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if string(got) != want {
+			t.Fatalf("ReadMessage = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestHeaderFramerRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := HeaderFramer{}.Writer(&buf)
+
+	msgs := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"a"}`,
+		`{"jsonrpc":"2.0","id":"two","method":"b","params":{"x":1}}`,
+	}
+	for _, m := range msgs {
+		if err := w.WriteMessage([]byte(m)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+	}
+
+	r := HeaderFramer{}.Reader(&buf)
+	for _, want := range msgs {
+		got, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if string(got) != want {
+			t.Fatalf("ReadMessage = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestHeaderFramerZeroLengthBody(t *testing.T) {
+	buf := bytes.NewBufferString("Content-Length: 0\r\n\r\n")
+
+	r := HeaderFramer{}.Reader(buf)
+	got, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("ReadMessage = %q, want empty", got)
+	}
+}
+
+func TestHeaderFramerIgnoresContentType(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"a"}`
+	buf := bytes.NewBufferString("Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body)
+
+	r := HeaderFramer{}.Reader(buf)
+	got, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if string(got) != body {
+		t.Fatalf("ReadMessage = %q, want %q", got, body)
+	}
+}
+
+func TestHeaderFramerMissingContentLength(t *testing.T) {
+	buf := bytes.NewBufferString("Content-Type: application/json\r\n\r\n")
+
+	r := HeaderFramer{}.Reader(buf)
+	if _, err := r.ReadMessage(); err == nil {
+		t.Fatal("ReadMessage succeeded, want an error for a missing Content-Length header")
+	}
+}
+
+func TestHeaderFramerMalformedHeaderLine(t *testing.T) {
+	buf := bytes.NewBufferString("not-a-header-line\r\n\r\n")
+
+	r := HeaderFramer{}.Reader(buf)
+	if _, err := r.ReadMessage(); err == nil {
+		t.Fatal("ReadMessage succeeded, want an error for a header line without a colon")
+	}
+}
+
+// TestHeaderFramerPartialReads confirms the reader assembles a message
+// correctly even when the underlying stream delivers it in arbitrarily
+// small chunks, which is the ordinary case for a real socket or pipe.
+func TestHeaderFramerPartialReads(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"a","params":{"x":1}}`
+	raw := []byte("Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		for _, b := range raw {
+			_, _ = client.Write([]byte{b})
+		}
+	}()
+
+	if err := server.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("SetReadDeadline: %v", err)
+	}
+	r := HeaderFramer{}.Reader(server)
+	got, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if string(got) != body {
+		t.Fatalf("ReadMessage = %q, want %q", got, body)
+	}
+}
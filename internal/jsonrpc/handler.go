@@ -1,16 +1,10 @@
 package jsonrpc
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
-	"log"
 	"net"
-	"sync"
+	"time"
 )
 
 type RequestHandler interface {
@@ -39,189 +33,83 @@ func NewHandler[TRequest, TResponse any](fn func(ctx context.Context, req TReque
 	}
 }
 
-type requestCanceler struct {
-	m sync.Map
-}
-
-func (rc *requestCanceler) cancelRequest(reqID int) {
-	v, ok := rc.m.LoadAndDelete(reqID)
-	if !ok {
-		return
-	}
-
-	cancelFn := v.(context.CancelFunc)
-	cancelFn()
-}
-
-func (rc *requestCanceler) finishRequest(reqID int) bool {
-	_, ok := rc.m.LoadAndDelete(reqID)
-	return ok
-}
-
-func (rc *requestCanceler) cancelAll() {
-	rc.m.Range(func(_, v any) bool {
-		cancelFn := v.(context.CancelFunc)
-		cancelFn()
-		return true
-	})
-
-	rc.m.Clear()
-}
-
-func (rc *requestCanceler) addRequest(reqID int, cancelFn context.CancelFunc) {
-	rc.m.Store(reqID, cancelFn)
-}
-
+// Listener holds the configuration used to serve connections: the request
+// handlers, the wire framing, any request deadlines, and where structured
+// events go. Serving itself is done by [Conn], which ListenStream builds
+// and runs for each connection.
 type Listener struct {
-	canceler requestCanceler
 	handlers map[string]RequestHandler
-}
+	framer   Framer
+	logger   Logger
 
-func NewListener(handlers map[string]RequestHandler) *Listener {
-	return &Listener{
-		handlers: handlers,
-	}
+	requestTimeout  time.Duration
+	handlerTimeouts map[string]time.Duration
 }
 
-func (l *Listener) ListenStream(ctx context.Context, conn net.Conn) error {
-	connCtx, cancelFn := context.WithCancel(ctx)
-	defer cancelFn()
-	defer l.canceler.cancelAll()
-
-	go func() {
-		<-ctx.Done()
-		_ = conn.Close()
-	}()
-
-	reader := bufio.NewReader(conn)
-
-	// Requests are delimited by \n character.
-	for {
-		data, err := reader.ReadBytes('\n')
-		if len(data) > 0 {
-			trimmed := bytes.TrimSpace(data)
-			if len(trimmed) == 0 {
-				if err != nil {
-					log.Printf("empty request payload %q", data)
-				}
-				continue
-			}
-			if err := l.handleRequest(connCtx, conn, trimmed); err != nil {
-				log.Printf("failed to handle request: %s", err)
-			}
-		}
+// ListenerOption configures optional [Listener] behavior.
+type ListenerOption func(*Listener)
 
-		if err != nil {
-			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
-				return nil
-			}
-			if connCtx.Err() != nil {
-				return nil
-			}
-
-			return fmt.Errorf("connection read failed: %w", err)
-		}
+// WithFramer sets how messages are delimited on the wire. The default is
+// [LineFramer], preserving the listener's original behavior.
+func WithFramer(f Framer) ListenerOption {
+	return func(l *Listener) {
+		l.framer = f
 	}
-
-	return nil
 }
 
-func (l *Listener) handleRequest(ctx context.Context, w io.Writer, data []byte) error {
-	var req Request
-	if err := json.Unmarshal(data, &req); err != nil {
-		return l.serveError(w, 0, NewError(ErrorCodeParseError, err))
+// WithRequestTimeout bounds how long any single request may run before it
+// is canceled and answered with [ErrorCodeRequestTimeout]. It applies to
+// every method without a more specific [WithHandlerTimeout]. Loading a
+// large package graph can otherwise hang the driver indefinitely.
+func WithRequestTimeout(d time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.requestTimeout = d
 	}
+}
 
-	if req.ID == 0 {
-		err := l.handleNotification(&req)
-		if err != nil {
-			return l.serveResponse(w, WrapError(err).AsResponse(0))
+// WithHandlerTimeout overrides the request timeout for a single method,
+// taking precedence over [WithRequestTimeout].
+func WithHandlerTimeout(method string, d time.Duration) ListenerOption {
+	return func(l *Listener) {
+		if l.handlerTimeouts == nil {
+			l.handlerTimeouts = make(map[string]time.Duration)
 		}
-
-		return nil
+		l.handlerTimeouts[method] = d
 	}
+}
 
-	handler, ok := l.handlers[req.Method]
-	if !ok {
-		err := ErrorCodeMethodNotFound.Errorf("method not found: %q", req.Method)
-		return l.serveResponse(w, err.AsResponse(req.ID))
+// timeoutFor returns the configured timeout for method, or zero if none
+// applies.
+func (l *Listener) timeoutFor(method string) time.Duration {
+	if d, ok := l.handlerTimeouts[method]; ok {
+		return d
 	}
-
-	reqCtx, cancelFn := context.WithCancel(ctx)
-	l.canceler.addRequest(req.ID, cancelFn)
-
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Panic: %s", r)
-				_ = l.serveError(w, req.ID, ErrorCodeInternalError.Errorf("%s", r))
-			}
-		}()
-
-		defer cancelFn()
-		defer l.canceler.finishRequest(req.ID)
-
-		rsp := &Response{
-			ID: req.ID,
-		}
-
-		out, err := handler.HandleRequest(reqCtx, req.Params)
-		if err != nil {
-			rsp.Error = WrapError(err)
-		}
-
-		rsp.Result = out
-		if ctx.Err() != nil {
-			return
-		}
-
-		if err := l.serveResponse(w, rsp); err != nil {
-			log.Printf(
-				"failed to respond: %s (reqID=%v method=%q)",
-				err, req.ID, req.Method,
-			)
-		}
-	}()
-
-	return nil
+	return l.requestTimeout
 }
 
-func (l *Listener) handleNotification(req *Request) error {
-	if req.Method != NotificationCancelRequest {
-		return ErrorCodeMethodNotFound.Errorf(
-			"unsupported notification %q", req.Method,
-		)
+// WithLogger sets the sink for structured request/connection events. The
+// default is a no-op logger, preserving silence for callers that don't
+// configure one. See [NewJSONLogger] for a ready-made stderr adapter.
+func WithLogger(logger Logger) ListenerOption {
+	return func(l *Listener) {
+		l.logger = logger
 	}
+}
 
-	var reqID int
-	if err := json.Unmarshal(req.Params, &reqID); err != nil {
-		return ErrorCodeInvalidParams.Errorf(
-			"cannot read params: %s", err,
-		)
+func NewListener(handlers map[string]RequestHandler, opts ...ListenerOption) *Listener {
+	l := &Listener{
+		handlers: handlers,
+		framer:   LineFramer{},
+		logger:   noopLogger{},
 	}
-
-	if reqID == 0 {
-		return ErrorCodeInvalidParams.Errorf(
-			"missing request ID",
-		)
+	for _, opt := range opts {
+		opt(l)
 	}
-
-	l.canceler.cancelRequest(reqID)
-	return nil
+	return l
 }
 
-func (l *Listener) serveError(dst io.Writer, reqID int, e *Error) error {
-	return l.serveResponse(dst, e.AsResponse(reqID))
-}
-
-func (l *Listener) serveResponse(dst io.Writer, rsp *Response) error {
-	buff := bytes.NewBuffer(make([]byte, 1024))
-
-	// NOTE: responses should be delimited by LF (\n).
-	if err := json.NewEncoder(buff).Encode(rsp); err != nil {
-		return fmt.Errorf("failed to serialize response: %w", err)
-	}
-
-	_, err := dst.Write(buff.Bytes())
-	return err
+// ListenStream serves conn until ctx is canceled or the connection closes.
+func (l *Listener) ListenStream(ctx context.Context, conn net.Conn) error {
+	c := l.newConn(conn)
+	return c.Run(ctx)
 }
@@ -0,0 +1,74 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Version is the mandatory "jsonrpc" member of every JSON-RPC 2.0 message.
+// It always marshals to "2.0" and rejects anything else on unmarshal.
+type Version struct{}
+
+func (Version) MarshalJSON() ([]byte, error) {
+	return []byte(`"2.0"`), nil
+}
+
+func (*Version) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("jsonrpc: invalid version: %w", err)
+	}
+	if s != "2.0" {
+		return fmt.Errorf("jsonrpc: unsupported version %q", s)
+	}
+	return nil
+}
+
+// ID is a JSON-RPC request identifier. Per the spec it is either a string,
+// a number, or absent (the latter marking a notification). ID holds the raw
+// JSON so it round-trips exactly regardless of which form was used.
+type ID struct {
+	raw json.RawMessage
+}
+
+// IDInt constructs a numeric ID.
+func IDInt(v int64) ID {
+	return ID{raw: json.RawMessage(strconv.FormatInt(v, 10))}
+}
+
+// IDString constructs a string ID.
+func IDString(v string) ID {
+	b, _ := json.Marshal(v)
+	return ID{raw: b}
+}
+
+// IsZero reports whether id was never set, i.e. the zero [ID] value.
+func (id ID) IsZero() bool {
+	return len(id.raw) == 0
+}
+
+// key returns a comparable representation of id suitable for use as a map
+// key; it is not meant for display.
+func (id ID) key() string {
+	return string(id.raw)
+}
+
+func (id ID) String() string {
+	if id.IsZero() {
+		return "<none>"
+	}
+	return string(id.raw)
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	if id.IsZero() {
+		return []byte("null"), nil
+	}
+	return id.raw, nil
+}
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	id.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
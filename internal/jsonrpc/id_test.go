@@ -0,0 +1,70 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIDRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		id   ID
+		want string
+	}{
+		{"int", IDInt(42), "42"},
+		{"string", IDString("req-1"), `"req-1"`},
+		{"zero", ID{}, "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.id)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if got := string(data); got != tt.want {
+				t.Fatalf("Marshal(%v) = %s, want %s", tt.id, got, tt.want)
+			}
+
+			var got ID
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal(%s): %v", data, err)
+			}
+			if got2, err := json.Marshal(got); err != nil || string(got2) != tt.want {
+				t.Fatalf("round-trip Marshal(Unmarshal(%s)) = %s, %v, want %s", data, got2, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIDIsZero(t *testing.T) {
+	if !(ID{}).IsZero() {
+		t.Error("zero value ID.IsZero() = false, want true")
+	}
+	if IDInt(0).IsZero() {
+		t.Error("IDInt(0).IsZero() = true, want false: a numeric ID of 0 is a valid, present ID")
+	}
+	if IDString("").IsZero() {
+		t.Error(`IDString("").IsZero() = true, want false`)
+	}
+}
+
+func TestRequestIsNotificationUsesAbsentID(t *testing.T) {
+	zero := IDInt(0)
+	tests := []struct {
+		name string
+		req  Request
+		want bool
+	}{
+		{"nil ID is a notification", Request{Method: "foo"}, true},
+		{"present ID 0 is a request, not a notification", Request{Method: "foo", ID: &zero}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.IsNotification(); got != tt.want {
+				t.Errorf("IsNotification() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
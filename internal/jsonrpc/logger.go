@@ -0,0 +1,118 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Logger receives structured events as a [Conn] serves and issues requests.
+// Implementations must be safe for concurrent use, since events are emitted
+// from per-request goroutines. Each method receives only the fields
+// relevant to its event.
+type Logger interface {
+	RequestReceived(method string, id ID)
+	RequestCompleted(method string, id ID, d time.Duration, errCode ErrorCode)
+	NotificationReceived(method string)
+	PanicRecovered(method string, id ID, recovered any)
+	ConnectionClosed(err error)
+
+	// DispatchFailed reports that an inbound message could not be handled
+	// on the read loop, e.g. malformed JSON, an unreadable batch, a
+	// notification that could not be handled, a response to an unknown
+	// call, or a failure writing a reply produced synchronously.
+	DispatchFailed(err error)
+
+	// ResponseFailed reports that a request completed but writing its
+	// response back to the peer failed, e.g. because the connection had
+	// already closed.
+	ResponseFailed(method string, id ID, err error)
+}
+
+// noopLogger discards every event. It is the default [Listener]/[Conn]
+// logger, preserving the silent behavior of methods that don't care to
+// observe traffic.
+type noopLogger struct{}
+
+func (noopLogger) RequestReceived(string, ID)                            {}
+func (noopLogger) RequestCompleted(string, ID, time.Duration, ErrorCode) {}
+func (noopLogger) NotificationReceived(string)                           {}
+func (noopLogger) PanicRecovered(string, ID, any)                        {}
+func (noopLogger) ConnectionClosed(error)                                {}
+func (noopLogger) DispatchFailed(error)                                  {}
+func (noopLogger) ResponseFailed(string, ID, error)                      {}
+
+// logEvent is the record shape written by [NewJSONLogger], one per line.
+type logEvent struct {
+	Time      time.Time     `json:"time"`
+	Event     string        `json:"event"`
+	Method    string        `json:"method,omitempty"`
+	ID        string        `json:"id,omitempty"`
+	Duration  time.Duration `json:"duration,omitempty"`
+	ErrorCode ErrorCode     `json:"error_code,omitempty"`
+	Panic     string        `json:"panic,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// jsonLogger writes one JSON object per line to a file, guarding writes
+// with a mutex since writes may come from concurrent requests.
+type jsonLogger struct {
+	mu sync.Mutex
+	w  *os.File
+}
+
+// NewJSONLogger returns a [Logger] that writes newline-delimited JSON
+// records to w, e.g. os.Stderr, so a host process (or the browser devtools
+// console, for the WASM driver) can pick up structured telemetry without
+// any change to the wire protocol.
+func NewJSONLogger(w *os.File) Logger {
+	return &jsonLogger{w: w}
+}
+
+func (l *jsonLogger) emit(ev logEvent) {
+	ev.Time = time.Now()
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(data)
+}
+
+func (l *jsonLogger) RequestReceived(method string, id ID) {
+	l.emit(logEvent{Event: "request_received", Method: method, ID: id.String()})
+}
+
+func (l *jsonLogger) RequestCompleted(method string, id ID, d time.Duration, errCode ErrorCode) {
+	l.emit(logEvent{Event: "request_completed", Method: method, ID: id.String(), Duration: d, ErrorCode: errCode})
+}
+
+func (l *jsonLogger) NotificationReceived(method string) {
+	l.emit(logEvent{Event: "notification_received", Method: method})
+}
+
+func (l *jsonLogger) PanicRecovered(method string, id ID, recovered any) {
+	l.emit(logEvent{Event: "panic_recovered", Method: method, ID: id.String(), Panic: fmt.Sprintf("%v", recovered)})
+}
+
+func (l *jsonLogger) ConnectionClosed(err error) {
+	ev := logEvent{Event: "connection_closed"}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	l.emit(ev)
+}
+
+func (l *jsonLogger) DispatchFailed(err error) {
+	l.emit(logEvent{Event: "dispatch_failed", Error: err.Error()})
+}
+
+func (l *jsonLogger) ResponseFailed(method string, id ID, err error) {
+	l.emit(logEvent{Event: "response_failed", Method: method, ID: id.String(), Error: err.Error()})
+}
@@ -9,16 +9,27 @@ import (
 
 const NotificationCancelRequest = "$/cancelRequest"
 
+// Request is a JSON-RPC 2.0 request or notification. A nil ID marks a
+// notification: the spec distinguishes the two by the member being absent,
+// not by any particular ID value.
 type Request struct {
-	ID     int             `json:"id,omitempty"`
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params,omitempty"`
+	Version Version         `json:"jsonrpc"`
+	ID      *ID             `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// IsNotification reports whether req carries no ID and therefore expects no
+// response.
+func (req *Request) IsNotification() bool {
+	return req.ID == nil
 }
 
 type Response struct {
-	ID     int    `json:"id"`
-	Result any    `json:"result,omitempty"`
-	Error  *Error `json:"error,omitempty"`
+	Version Version `json:"jsonrpc"`
+	ID      ID      `json:"id"`
+	Result  any     `json:"result,omitempty"`
+	Error   *Error  `json:"error,omitempty"`
 }
 
 type ErrorCode int
@@ -29,6 +40,11 @@ const (
 	ErrorCodeMethodNotFound ErrorCode = -32601
 	ErrorCodeInvalidParams  ErrorCode = -32602
 	ErrorCodeInternalError  ErrorCode = -32603
+
+	// ErrorCodeRequestTimeout is returned when a request exceeds the
+	// deadline configured via WithRequestTimeout/WithHandlerTimeout. It
+	// uses a reserved-for-implementation-use server code.
+	ErrorCodeRequestTimeout ErrorCode = -32001
 )
 
 func (code ErrorCode) Errorf(format string, args ...any) *Error {
@@ -60,7 +76,7 @@ func NewError(code ErrorCode, err error) *Error {
 	}
 }
 
-func (err *Error) AsResponse(reqID int) *Response {
+func (err *Error) AsResponse(reqID ID) *Response {
 	return &Response{
 		ID:    reqID,
 		Error: err,
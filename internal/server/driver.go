@@ -0,0 +1,635 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/Better-Go-Playground/go-packages-driver-wasm/internal/jsonrpc"
+)
+
+// methodHostReadFile is the method this driver calls back on the serving
+// [jsonrpc.Conn] to ask the host to read a file neither the overlay nor the
+// local filesystem has, e.g. a GOROOT stdlib source when the driver is
+// running under js/wasm with no real filesystem of its own.
+const methodHostReadFile = "goPackageDriver/readFile"
+
+type hostReadFileParams struct {
+	Path string `json:"path"`
+}
+
+type hostReadFileResult struct {
+	Contents []byte `json:"contents"`
+}
+
+// errNoGoMod is returned by findModule when no go.mod is reachable from the
+// work dir. It signals the driver should decline the request rather than
+// fail it outright.
+var errNoGoMod = errors.New("no go.mod found")
+
+// overlay maps absolute file paths to their in-memory contents, as supplied
+// by packages.DriverRequest.Overlay.
+type overlay map[string][]byte
+
+func (o overlay) readFile(name string) ([]byte, bool) {
+	data, ok := o[name]
+	return data, ok
+}
+
+// fileReader reads a single source file by absolute path, as used
+// throughout the driver in place of calling the overlay/os.ReadFile/host
+// separately at every call site.
+type fileReader func(name string) ([]byte, error)
+
+// newFileReader builds the [fileReader] for one driver run: the overlay is
+// tried first, then the real filesystem, and finally - if host is non-nil -
+// a [methodHostReadFile] call back to whatever is on the other end of the
+// connection. The host fallback is what lets this driver run where there is
+// no real filesystem to fall back to, e.g. under js/wasm in a browser,
+// where the JS host is the only thing that can read GOROOT/module-cache
+// sources.
+func newFileReader(ctx context.Context, ov overlay, host *jsonrpc.Conn) fileReader {
+	return func(name string) ([]byte, error) {
+		if data, ok := ov.readFile(name); ok {
+			return data, nil
+		}
+
+		data, err := os.ReadFile(name)
+		if err == nil {
+			return data, nil
+		}
+		if host == nil {
+			return nil, err
+		}
+
+		var result hostReadFileResult
+		if callErr := host.Call(ctx, methodHostReadFile, hostReadFileParams{Path: name}, &result); callErr != nil {
+			return nil, err
+		}
+		return result.Contents, nil
+	}
+}
+
+// moduleInfo is the subset of go.mod this driver understands.
+type moduleInfo struct {
+	path     string
+	dir      string
+	requires []module.Version
+}
+
+// findModule walks upward from startDir looking for a go.mod, reading each
+// candidate through read.
+func findModule(read fileReader, startDir string) (*moduleInfo, error) {
+	for dir := startDir; ; {
+		gomod := filepath.Join(dir, "go.mod")
+		if data, err := read(gomod); err == nil {
+			mf, err := modfile.Parse(gomod, data, nil)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", gomod, err)
+			}
+
+			mi := &moduleInfo{path: mf.Module.Mod.Path, dir: dir}
+			for _, r := range mf.Require {
+				mi.requires = append(mi.requires, r.Mod)
+			}
+			return mi, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errNoGoMod
+		}
+		dir = parent
+	}
+}
+
+func lookupEnv(env []string, key string) (string, bool) {
+	prefix := key + "="
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, prefix); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// resolveEnv reads key from the driver request's env, falling back to this
+// process's environment and finally to fallback.
+func resolveEnv(env []string, key, fallback string) string {
+	if v, ok := lookupEnv(env, key); ok && v != "" {
+		return v
+	}
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// fileInfo is the result of parsing a single Go source file for its package
+// clause and import block.
+type fileInfo struct {
+	pkgName string
+	imports []string
+}
+
+func (d *driver) parseGoFile(name string) (*fileInfo, error) {
+	src, err := d.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := parser.ParseFile(d.fset, name, src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	fi := &fileInfo{pkgName: f.Name.Name}
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		fi.imports = append(fi.imports, p)
+	}
+	return fi, nil
+}
+
+// buildContext returns a [build.Context] configured for this request's
+// target GOOS/GOARCH/cgo setting, reading file contents through the
+// overlay the same way the rest of the driver does. It is used solely to
+// evaluate build constraints via [build.Context.MatchFile]; nothing here
+// performs an actual build.
+func (d *driver) buildContext() *build.Context {
+	bc := build.Default
+	bc.GOOS = d.goos
+	bc.GOARCH = d.goarch
+	bc.CgoEnabled = d.cgoEnabled
+	bc.OpenFile = func(path string) (io.ReadCloser, error) {
+		data, err := d.readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return &bc
+}
+
+// matchesBuildConstraints reports whether the file dir/name would be
+// included in the build for this request's GOOS/GOARCH, honoring both the
+// _GOOS/_GOARCH filename suffix convention and //go:build directives. A
+// file that fails to parse (or doesn't exist) is excluded rather than
+// erroring out the whole load, matching how `go list` silently drops
+// unbuildable files from a directory listing.
+func (d *driver) matchesBuildConstraints(dir, name string) bool {
+	match, err := d.buildContext().MatchFile(dir, name)
+	return err == nil && match
+}
+
+// listGoFiles returns the absolute paths of the .go files in dir that this
+// request's GOOS/GOARCH would build, merging the overlay on top of the real
+// directory contents.
+func (d *driver) listGoFiles(dir string, includeTests bool) ([]string, error) {
+	want := func(name string) bool {
+		if !strings.HasSuffix(name, ".go") {
+			return false
+		}
+		if !includeTests && strings.HasSuffix(name, "_test.go") {
+			return false
+		}
+		return d.matchesBuildConstraints(dir, name)
+	}
+
+	seen := map[string]bool{}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && want(e.Name()) {
+			seen[e.Name()] = true
+		}
+	}
+
+	clean := filepath.Clean(dir)
+	for abs := range d.overlay {
+		if filepath.Dir(abs) == clean && want(filepath.Base(abs)) {
+			seen[filepath.Base(abs)] = true
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for name := range seen {
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// target is a single directory this driver needs to turn into a
+// *packages.Package, paired with the import path it resolves to.
+type target struct {
+	dir        string
+	importPath string
+}
+
+// driver implements one goPackageDriver/query call. It is built fresh per
+// request and keeps no state across requests.
+type driver struct {
+	ri      RuntimeInfo
+	workDir string
+	overlay overlay
+	tests   bool
+	fset    *token.FileSet
+
+	readFile fileReader
+
+	mod        *moduleInfo
+	goroot     string
+	gomodcache string
+
+	goos       string
+	goarch     string
+	cgoEnabled bool
+
+	pkgs map[string]*packages.Package // by ID, i.e. by PkgPath
+}
+
+// newDriver builds a driver for one goPackageDriver/query call. host is the
+// connection the request arrived on, used to read files the overlay and
+// local filesystem don't have (see [newFileReader]); it is nil when the
+// handler wasn't invoked through a [jsonrpc.Conn], e.g. in tests.
+func newDriver(ctx context.Context, ri RuntimeInfo, req *DriverRequestEnvelope, host *jsonrpc.Conn) (*driver, error) {
+	ov := overlay(req.DriverRequest.Overlay)
+	read := newFileReader(ctx, ov, host)
+
+	mod, err := findModule(read, req.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+
+	env := req.DriverRequest.Env
+	goroot := resolveEnv(env, "GOROOT", runtime.GOROOT())
+	gopath := resolveEnv(env, "GOPATH", filepath.Join(os.Getenv("HOME"), "go"))
+	gomodcache := resolveEnv(env, "GOMODCACHE", filepath.Join(gopath, "pkg", "mod"))
+	goos := resolveEnv(env, "GOOS", runtime.GOOS)
+	goarch := resolveEnv(env, "GOARCH", runtime.GOARCH)
+	cgoEnabled := resolveEnv(env, "CGO_ENABLED", "0") == "1"
+
+	return &driver{
+		ri:         ri,
+		workDir:    req.WorkDir,
+		overlay:    ov,
+		tests:      req.DriverRequest.Tests,
+		fset:       token.NewFileSet(),
+		readFile:   read,
+		mod:        mod,
+		goroot:     goroot,
+		gomodcache: gomodcache,
+		goos:       goos,
+		goarch:     goarch,
+		cgoEnabled: cgoEnabled,
+		pkgs:       map[string]*packages.Package{},
+	}, nil
+}
+
+func (d *driver) run(ctx context.Context, patterns []string, mode packages.LoadMode) (*packages.DriverResponse, error) {
+	targets, err := d.resolvePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make([]string, 0, len(targets))
+	for _, t := range targets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		pkg, err := d.loadPackage(t.dir, t.importPath, mode)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", t.importPath, err)
+		}
+		roots = append(roots, pkg.ID)
+	}
+	sort.Strings(roots)
+
+	pkgs := make([]*packages.Package, 0, len(d.pkgs))
+	for _, pkg := range d.pkgs {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].ID < pkgs[j].ID })
+
+	return &packages.DriverResponse{
+		Compiler:  d.ri.Compiler,
+		Arch:      d.ri.Arch,
+		Roots:     roots,
+		Packages:  pkgs,
+		GoVersion: d.ri.GoMinorVersion,
+	}, nil
+}
+
+// resolvePatterns expands the requested patterns into concrete directories.
+//
+// Supported forms: "./...", "./dir/...", "./dir", a bare import path,
+// "<import path>/..." as long as the import path lies inside this module,
+// and the two special forms the go/packages external driver protocol
+// requires every driver to accept (see golang.org/x/tools/go/packages
+// doc.go): "file=<absolute path>", resolving to the package containing
+// that file, and "pattern=<pattern>", which re-resolves <pattern> through
+// this same function. Patterns rooted outside the module (e.g. a
+// dependency's "...") are not expanded recursively.
+func (d *driver) resolvePatterns(patterns []string) ([]target, error) {
+	var targets []target
+	seen := map[string]bool{}
+	add := func(dir, importPath string) {
+		dir = filepath.Clean(dir)
+		if seen[importPath] {
+			return
+		}
+		seen[importPath] = true
+		targets = append(targets, target{dir: dir, importPath: importPath})
+	}
+
+	for _, pat := range patterns {
+		switch {
+		case strings.HasPrefix(pat, "file="):
+			file := strings.TrimPrefix(pat, "file=")
+			dir := filepath.Dir(file)
+			importPath, err := d.importPathForDir(dir)
+			if err != nil {
+				return nil, err
+			}
+			add(dir, importPath)
+
+		case strings.HasPrefix(pat, "pattern="):
+			inner, err := d.resolvePatterns([]string{strings.TrimPrefix(pat, "pattern=")})
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range inner {
+				add(t.dir, t.importPath)
+			}
+
+		case pat == "./...":
+			root := d.workDir
+			rootPath, err := d.importPathForDir(root)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.walkDirs(root, rootPath, add); err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(pat, "./") && strings.HasSuffix(pat, "/..."):
+			root := filepath.Join(d.workDir, strings.TrimSuffix(strings.TrimPrefix(pat, "./"), "/..."))
+			rootPath, err := d.importPathForDir(root)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.walkDirs(root, rootPath, add); err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(pat, "."):
+			dir := filepath.Join(d.workDir, strings.TrimPrefix(pat, "./"))
+			importPath, err := d.importPathForDir(dir)
+			if err != nil {
+				return nil, err
+			}
+			add(dir, importPath)
+
+		case strings.HasSuffix(pat, "/..."):
+			base := strings.TrimSuffix(pat, "/...")
+			dir, ok := d.moduleLocalDir(base)
+			if !ok {
+				return nil, fmt.Errorf("cannot expand pattern %q outside module %s", pat, d.mod.path)
+			}
+			if err := d.walkDirs(dir, base, add); err != nil {
+				return nil, err
+			}
+
+		default:
+			dir, err := d.findImportDir(pat)
+			if err != nil {
+				return nil, err
+			}
+			add(dir, pat)
+		}
+	}
+
+	return targets, nil
+}
+
+// walkDirs adds every directory under root that contains at least one
+// matching Go file, skipping vendor, testdata, and dot/underscore dirs.
+func (d *driver) walkDirs(root, rootImportPath string, add func(dir, importPath string)) error {
+	return filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+
+		name := entry.Name()
+		if p != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+			return fs.SkipDir
+		}
+
+		files, err := d.listGoFiles(p, d.tests)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		importPath := rootImportPath
+		if rel != "." {
+			importPath = path.Join(rootImportPath, filepath.ToSlash(rel))
+		}
+		add(p, importPath)
+		return nil
+	})
+}
+
+func (d *driver) importPathForDir(dir string) (string, error) {
+	rel, err := filepath.Rel(d.mod.dir, dir)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return d.mod.path, nil
+	}
+	if strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is outside module %s", dir, d.mod.path)
+	}
+	return path.Join(d.mod.path, rel), nil
+}
+
+func (d *driver) moduleLocalDir(importPath string) (string, bool) {
+	if importPath == d.mod.path {
+		return d.mod.dir, true
+	}
+	prefix := d.mod.path + "/"
+	if !strings.HasPrefix(importPath, prefix) {
+		return "", false
+	}
+	return filepath.Join(d.mod.dir, filepath.FromSlash(strings.TrimPrefix(importPath, prefix))), true
+}
+
+func (d *driver) stdlibDir(importPath string) (string, bool) {
+	dir := filepath.Join(d.goroot, "src", filepath.FromSlash(importPath))
+	info, err := os.Stat(dir)
+	return dir, err == nil && info.IsDir()
+}
+
+// moduleCacheDir locates importPath in the module cache using the longest
+// matching require directive from the module's go.mod.
+func (d *driver) moduleCacheDir(importPath string) (string, bool, error) {
+	var best *module.Version
+	for i := range d.mod.requires {
+		r := d.mod.requires[i]
+		if r.Path != importPath && !strings.HasPrefix(importPath, r.Path+"/") {
+			continue
+		}
+		if best == nil || len(r.Path) > len(best.Path) {
+			best = &d.mod.requires[i]
+		}
+	}
+	if best == nil {
+		return "", false, nil
+	}
+
+	escPath, err := module.EscapePath(best.Path)
+	if err != nil {
+		return "", true, fmt.Errorf("escape module path %q: %w", best.Path, err)
+	}
+	escVer, err := module.EscapeVersion(best.Version)
+	if err != nil {
+		return "", true, fmt.Errorf("escape module version %q: %w", best.Version, err)
+	}
+
+	rel := strings.TrimPrefix(importPath, best.Path)
+	return filepath.Join(d.gomodcache, escPath+"@"+escVer, filepath.FromSlash(rel)), true, nil
+}
+
+func (d *driver) findImportDir(importPath string) (string, error) {
+	if dir, ok := d.moduleLocalDir(importPath); ok {
+		return dir, nil
+	}
+	if dir, ok := d.stdlibDir(importPath); ok {
+		return dir, nil
+	}
+	if dir, ok, err := d.moduleCacheDir(importPath); ok || err != nil {
+		return dir, err
+	}
+	return "", fmt.Errorf("cannot resolve import %q", importPath)
+}
+
+// loadPackage turns dir into a *packages.Package cached under importPath,
+// honoring mode for which fields get populated.
+func (d *driver) loadPackage(dir, importPath string, mode packages.LoadMode) (*packages.Package, error) {
+	if pkg, ok := d.pkgs[importPath]; ok {
+		return pkg, nil
+	}
+
+	pkg := &packages.Package{ID: importPath, PkgPath: importPath}
+	d.pkgs[importPath] = pkg
+
+	files, err := d.listGoFiles(dir, d.tests)
+	if err != nil {
+		pkg.Errors = append(pkg.Errors, packages.Error{Msg: err.Error(), Kind: packages.ListError})
+		return pkg, nil
+	}
+
+	imports := map[string]bool{}
+	for _, f := range files {
+		fi, err := d.parseGoFile(f)
+		if err != nil {
+			pkg.Errors = append(pkg.Errors, packages.Error{Pos: f, Msg: err.Error(), Kind: packages.ParseError})
+			continue
+		}
+		if pkg.Name == "" && !strings.HasSuffix(fi.pkgName, "_test") {
+			pkg.Name = fi.pkgName
+		}
+		for _, imp := range fi.imports {
+			imports[imp] = true
+		}
+	}
+
+	if mode&packages.NeedName == 0 {
+		pkg.Name = ""
+	}
+	if mode&packages.NeedFiles != 0 {
+		pkg.GoFiles = files
+	}
+	if mode&packages.NeedCompiledGoFiles != 0 {
+		pkg.CompiledGoFiles = files
+	}
+
+	if mode&packages.NeedImports != 0 && len(imports) > 0 {
+		sorted := make([]string, 0, len(imports))
+		for imp := range imports {
+			sorted = append(sorted, imp)
+		}
+		sort.Strings(sorted)
+
+		pkg.Imports = make(map[string]*packages.Package, len(sorted))
+		for _, imp := range sorted {
+			depID, err := d.resolveImport(imp, mode)
+			if err != nil {
+				pkg.Errors = append(pkg.Errors, packages.Error{Msg: err.Error(), Kind: packages.ListError})
+				continue
+			}
+			pkg.Imports[imp] = &packages.Package{ID: depID}
+		}
+	}
+
+	return pkg, nil
+}
+
+// resolveImport returns the package ID for imp, loading it fully when mode
+// asks for transitive dependencies and recording a minimal stub otherwise.
+func (d *driver) resolveImport(imp string, mode packages.LoadMode) (string, error) {
+	if pkg, ok := d.pkgs[imp]; ok {
+		return pkg.ID, nil
+	}
+
+	dir, err := d.findImportDir(imp)
+	if err != nil {
+		return "", err
+	}
+
+	if mode&packages.NeedDeps == 0 {
+		d.pkgs[imp] = &packages.Package{ID: imp, PkgPath: imp}
+		return imp, nil
+	}
+
+	pkg, err := d.loadPackage(dir, imp, mode)
+	if err != nil {
+		return "", err
+	}
+	return pkg.ID, nil
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/Better-Go-Playground/go-packages-driver-wasm/internal/jsonrpc"
+)
+
+func newTestDriver(t *testing.T, env []string, overlay map[string][]byte) *driver {
+	t.Helper()
+
+	req := &DriverRequestEnvelope{
+		WorkDir: "/repo",
+		DriverRequest: packages.DriverRequest{
+			Overlay: overlay,
+			Env:     env,
+		},
+	}
+	d, err := newDriver(context.Background(), RuntimeInfo{}, req, nil)
+	if err != nil {
+		t.Fatalf("newDriver: %v", err)
+	}
+	return d
+}
+
+func TestListGoFilesHonorsBuildConstraints(t *testing.T) {
+	d := newTestDriver(t, []string{"GOOS=darwin", "GOARCH=amd64"}, map[string][]byte{
+		"/repo/go.mod":                []byte("module example.com/repo\n\ngo 1.21\n"),
+		"/repo/pkg/a_linux.go":        []byte("package pkg\n"),
+		"/repo/pkg/a_darwin.go":       []byte("package pkg\n"),
+		"/repo/pkg/b.go":              []byte("package pkg\n"),
+		"/repo/pkg/c_windows_test.go": []byte("package pkg\n"),
+	})
+
+	files, err := d.listGoFiles("/repo/pkg", false)
+	if err != nil {
+		t.Fatalf("listGoFiles: %v", err)
+	}
+
+	want := []string{"/repo/pkg/a_darwin.go", "/repo/pkg/b.go"}
+	if len(files) != len(want) {
+		t.Fatalf("listGoFiles = %v, want %v", files, want)
+	}
+	for i, f := range files {
+		if f != want[i] {
+			t.Fatalf("listGoFiles = %v, want %v", files, want)
+		}
+	}
+}
+
+func TestResolvePatternsFile(t *testing.T) {
+	d := newTestDriver(t, nil, map[string][]byte{
+		"/repo/go.mod":   []byte("module example.com/repo\n\ngo 1.21\n"),
+		"/repo/pkg/b.go": []byte("package pkg\n"),
+	})
+
+	targets, err := d.resolvePatterns([]string{"file=/repo/pkg/b.go"})
+	if err != nil {
+		t.Fatalf("resolvePatterns: %v", err)
+	}
+	if len(targets) != 1 {
+		t.Fatalf("resolvePatterns = %v, want 1 target", targets)
+	}
+	if got, want := targets[0].importPath, "example.com/repo/pkg"; got != want {
+		t.Errorf("importPath = %q, want %q", got, want)
+	}
+	if got, want := targets[0].dir, "/repo/pkg"; got != want {
+		t.Errorf("dir = %q, want %q", got, want)
+	}
+}
+
+// TestNewFileReaderFallsBackToHost confirms that when a file is in neither
+// the overlay nor the local filesystem, the driver's fileReader asks the
+// host for it over a real jsonrpc.Conn, via methodHostReadFile - the path
+// that makes reading GOROOT/module-cache sources possible under js/wasm,
+// where there is no local filesystem to fall back to.
+func TestNewFileReaderFallsBackToHost(t *testing.T) {
+	driverSide, hostSide := net.Pipe()
+	defer driverSide.Close()
+	defer hostSide.Close()
+
+	const missingFile = "/goroot/src/fmt/print.go"
+	const contents = "package fmt\n"
+
+	var gotPath string
+	hostHandlers := map[string]jsonrpc.RequestHandler{
+		methodHostReadFile: jsonrpc.NewHandler(func(_ context.Context, req hostReadFileParams) (*hostReadFileResult, error) {
+			gotPath = req.Path
+			return &hostReadFileResult{Contents: []byte(contents)}, nil
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hostConn := jsonrpc.NewConn(hostSide, hostHandlers)
+	go func() { _ = hostConn.Run(ctx) }()
+
+	driverConn := jsonrpc.NewConn(driverSide, nil)
+	go func() { _ = driverConn.Run(ctx) }()
+
+	read := newFileReader(ctx, overlay{"/repo/go.mod": []byte("module example.com/repo\n")}, driverConn)
+
+	data, err := read(missingFile)
+	if err != nil {
+		t.Fatalf("read(%q): %v", missingFile, err)
+	}
+	if string(data) != contents {
+		t.Errorf("read(%q) = %q, want %q", missingFile, data, contents)
+	}
+	if gotPath != missingFile {
+		t.Errorf("host received path %q, want %q", gotPath, missingFile)
+	}
+}
+
+// TestNewDriverThreadsHostIntoFileReads is the same scenario driven through
+// newDriver, confirming the host connection passed to it actually reaches
+// the file reads a real query performs (here, findModule's go.mod lookup).
+func TestNewDriverThreadsHostIntoFileReads(t *testing.T) {
+	driverSide, hostSide := net.Pipe()
+	defer driverSide.Close()
+	defer hostSide.Close()
+
+	const gomod = "/repo/go.mod"
+
+	hostHandlers := map[string]jsonrpc.RequestHandler{
+		methodHostReadFile: jsonrpc.NewHandler(func(_ context.Context, req hostReadFileParams) (*hostReadFileResult, error) {
+			if req.Path != gomod {
+				return nil, fmt.Errorf("unexpected path %q", req.Path)
+			}
+			return &hostReadFileResult{Contents: []byte("module example.com/repo\n")}, nil
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hostConn := jsonrpc.NewConn(hostSide, hostHandlers)
+	go func() { _ = hostConn.Run(ctx) }()
+
+	driverConn := jsonrpc.NewConn(driverSide, nil)
+	go func() { _ = driverConn.Run(ctx) }()
+
+	req := &DriverRequestEnvelope{
+		WorkDir:       "/repo",
+		DriverRequest: packages.DriverRequest{},
+	}
+	d, err := newDriver(ctx, RuntimeInfo{}, req, driverConn)
+	if err != nil {
+		t.Fatalf("newDriver: %v", err)
+	}
+	if got, want := d.mod.path, "example.com/repo"; got != want {
+		t.Errorf("mod.path = %q, want %q (go.mod should have been read through the host)", got, want)
+	}
+}
+
+func TestResolvePatternsPattern(t *testing.T) {
+	d := newTestDriver(t, nil, map[string][]byte{
+		"/repo/go.mod":   []byte("module example.com/repo\n\ngo 1.21\n"),
+		"/repo/pkg/b.go": []byte("package pkg\n"),
+	})
+
+	targets, err := d.resolvePatterns([]string{"pattern=./pkg"})
+	if err != nil {
+		t.Fatalf("resolvePatterns: %v", err)
+	}
+	if len(targets) != 1 || targets[0].importPath != "example.com/repo/pkg" {
+		t.Fatalf("resolvePatterns = %v, want [example.com/repo/pkg]", targets)
+	}
+}
@@ -2,10 +2,13 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"regexp"
 	"runtime"
 	"strconv"
+	"time"
 
 	"golang.org/x/tools/go/packages"
 
@@ -14,6 +17,13 @@ import (
 
 var goMinorVerRegex = regexp.MustCompile(`(?m)^go1\.(\d+)`)
 
+// DefaultRequestTimeout bounds how long a single goPackageDriver/query may
+// run before the listener cancels it and replies with
+// jsonrpc.ErrorCodeRequestTimeout. Loading a large package graph can
+// otherwise hang the driver indefinitely; callers that need a different
+// bound can override it with WithRequestTimeout.
+const DefaultRequestTimeout = 30 * time.Second
+
 type DriverRequestEnvelope struct {
 	WorkDir       string                 `json:"workDir"`
 	Patterns      []string               `json:"patterns"`
@@ -21,25 +31,59 @@ type DriverRequestEnvelope struct {
 }
 
 type Service struct {
-	ri RuntimeInfo
+	ri             RuntimeInfo
+	requestTimeout time.Duration
+	logger         jsonrpc.Logger
+}
+
+// ServiceOption configures optional [Service] behavior.
+type ServiceOption func(*Service)
+
+// WithRequestTimeout overrides [DefaultRequestTimeout] for every request
+// served by the [Service]'s [jsonrpc.Listener].
+func WithRequestTimeout(d time.Duration) ServiceOption {
+	return func(svc *Service) {
+		svc.requestTimeout = d
+	}
+}
+
+// WithLogger overrides the default stderr JSON-lines logger (see
+// [jsonrpc.NewJSONLogger]) used by the [Service]'s [jsonrpc.Listener].
+func WithLogger(logger jsonrpc.Logger) ServiceOption {
+	return func(svc *Service) {
+		svc.logger = logger
+	}
 }
 
-func NewService(ri RuntimeInfo) Service {
-	return Service{
-		ri: ri,
+func NewService(ri RuntimeInfo, opts ...ServiceOption) Service {
+	svc := Service{
+		ri:             ri,
+		requestTimeout: DefaultRequestTimeout,
+		logger:         jsonrpc.NewJSONLogger(os.Stderr),
+	}
+	for _, opt := range opts {
+		opt(&svc)
 	}
+	return svc
 }
 
 func (svc Service) handleDriverRequest(ctx context.Context, req *DriverRequestEnvelope) (*packages.DriverResponse, error) {
-	// TODO: implement driver logic
-	return &packages.DriverResponse{
-		NotHandled: true,
-		Compiler:   svc.ri.Compiler,
-		Arch:       svc.ri.Arch,
-		Roots:      []string{},
-		Packages:   []*packages.Package{},
-		GoVersion:  svc.ri.GoMinorVersion,
-	}, nil
+	host, _ := jsonrpc.ConnFromContext(ctx)
+
+	d, err := newDriver(ctx, svc.ri, req, host)
+	if err != nil {
+		if errors.Is(err, errNoGoMod) {
+			return &packages.DriverResponse{
+				NotHandled: true,
+				Compiler:   svc.ri.Compiler,
+				Arch:       svc.ri.Arch,
+				GoVersion:  svc.ri.GoMinorVersion,
+			}, nil
+		}
+		return nil, fmt.Errorf("failed to initialize driver: %w", err)
+	}
+
+	return d.run(ctx, req.Patterns, req.DriverRequest.Mode)
 }
 
 func (svc Service) Listener() *jsonrpc.Listener {
@@ -47,7 +91,11 @@ func (svc Service) Listener() *jsonrpc.Listener {
 		"goPackageDriver/query": jsonrpc.NewHandler(svc.handleDriverRequest),
 	}
 
-	return jsonrpc.NewListener(handlers)
+	return jsonrpc.NewListener(
+		handlers,
+		jsonrpc.WithRequestTimeout(svc.requestTimeout),
+		jsonrpc.WithLogger(svc.logger),
+	)
 }
 
 type RuntimeInfo struct {